@@ -18,13 +18,17 @@
 package errors
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+
+	"google.golang.org/grpc/codes"
 )
 
 // --------------------------------------------------------------------
@@ -56,24 +60,176 @@ func Summary(err error) string {
 
 // --------------------------------------------------------------------
 
-// NotFound is a generic NotFound error.
-type NotFound struct {
+// Kind classifies a Coded error into a small taxonomy modeled after the
+// gRPC/Google-API status codes.
+type Kind string
+
+const (
+	KindNotFound          Kind = "not found"
+	KindAlreadyExists     Kind = "already exists"
+	KindPermissionDenied  Kind = "permission denied"
+	KindUnauthenticated   Kind = "unauthenticated"
+	KindInvalidArgument   Kind = "invalid argument"
+	KindResourceExhausted Kind = "resource exhausted"
+	KindUnavailable       Kind = "unavailable"
+	KindDeadlineExceeded  Kind = "deadline exceeded"
+	KindInternal          Kind = "internal"
+	KindCanceled          Kind = "canceled"
+)
+
+// Coded is a generic domain error tagged with a Kind, e.g. KindNotFound or
+// KindPermissionDenied. Category names the kind of thing the error is about
+// (e.g. "user", "bucket"); Message, if set, overrides the default rendering
+// of Category and Kind.
+type Coded struct {
+	Kind     Kind
 	Category string
+	Message  string
+	Err      error
+}
+
+// NewCoded creates a new Coded error of the given kind.
+func NewCoded(kind Kind, category string) *Coded {
+	return &Coded{Kind: kind, Category: category}
+}
+
+func (p *Coded) Error() string {
+	if p.Message != "" {
+		return p.Message
+	}
+	if p.Category != "" {
+		return p.Category + " " + string(p.Kind)
+	}
+	return string(p.Kind)
 }
 
+// Unwrap provides compatibility for Go 1.13 error chains.
+func (p *Coded) Unwrap() error {
+	return p.Err
+}
+
+// Is reports whether err's chain (including through *Frame) contains a
+// Coded error of the given kind.
+func Is(err error, kind Kind) bool {
+	for err != nil {
+		switch e := err.(type) {
+		case *Coded:
+			if e.Kind == kind {
+				return true
+			}
+			err = e.Err
+			continue
+		case *NotFound:
+			return kind == KindNotFound
+		case *Frame:
+			err = e.Err
+			continue
+		}
+		if e, ok := err.(interface{ Unwrap() error }); ok {
+			err = e.Unwrap()
+			continue
+		}
+		break
+	}
+	return false
+}
+
+// NotFound is a generic NotFound error, kept for backward compatibility as a
+// subtype of Coded: it shares Coded's fields (Kind is unused and left zero)
+// but renders the same "<Category> not found" message it always has.
+type NotFound Coded
+
 func (p *NotFound) Error() string {
 	return p.Category + " not found"
 }
 
-// IsNotFound unwraps err and checks it is a *NotFound object or not.
+// IsNotFound unwraps err and checks it is a *NotFound object (or a Coded
+// error of Kind KindNotFound).
 func IsNotFound(err error) bool {
-	for {
+	return Is(err, KindNotFound)
+}
+
+// kindOf returns the Kind carried by err's chain, if any.
+func kindOf(err error) (Kind, bool) {
+	for err != nil {
+		switch e := err.(type) {
+		case *Coded:
+			return e.Kind, true
+		case *NotFound:
+			return KindNotFound, true
+		case *Frame:
+			err = e.Err
+			continue
+		}
 		if e, ok := err.(interface{ Unwrap() error }); ok {
 			err = e.Unwrap()
-		} else {
-			_, ok = err.(*NotFound)
-			return ok
+			continue
 		}
+		break
+	}
+	return "", false
+}
+
+// HTTPStatus maps err's Kind (see Is, Coded) to an HTTP status code, so
+// service code can translate any wrapped error to a transport status
+// uniformly. Errors with no recognized Kind map to 500.
+func HTTPStatus(err error) int {
+	kind, ok := kindOf(err)
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	switch kind {
+	case KindNotFound:
+		return http.StatusNotFound
+	case KindAlreadyExists:
+		return http.StatusConflict
+	case KindPermissionDenied:
+		return http.StatusForbidden
+	case KindUnauthenticated:
+		return http.StatusUnauthorized
+	case KindInvalidArgument:
+		return http.StatusBadRequest
+	case KindResourceExhausted:
+		return http.StatusTooManyRequests
+	case KindUnavailable:
+		return http.StatusServiceUnavailable
+	case KindDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case KindCanceled:
+		return 499 // client closed request; no net/http constant
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// GRPCCode maps err's Kind (see Is, Coded) to a gRPC status code. Errors
+// with no recognized Kind map to codes.Internal.
+func GRPCCode(err error) codes.Code {
+	kind, ok := kindOf(err)
+	if !ok {
+		return codes.Internal
+	}
+	switch kind {
+	case KindNotFound:
+		return codes.NotFound
+	case KindAlreadyExists:
+		return codes.AlreadyExists
+	case KindPermissionDenied:
+		return codes.PermissionDenied
+	case KindUnauthenticated:
+		return codes.Unauthenticated
+	case KindInvalidArgument:
+		return codes.InvalidArgument
+	case KindResourceExhausted:
+		return codes.ResourceExhausted
+	case KindUnavailable:
+		return codes.Unavailable
+	case KindDeadlineExceeded:
+		return codes.DeadlineExceeded
+	case KindCanceled:
+		return codes.Canceled
+	default:
+		return codes.Internal
 	}
 }
 
@@ -129,6 +285,10 @@ func (p List) ToError() error {
 func (p List) Format(s fmt.State, verb rune) {
 	switch verb {
 	case 'v':
+		if s.Flag('+') {
+			s.Write(FormatWith(p, defaultFormatter))
+			return
+		}
 		io.WriteString(s, p.Error())
 	case 's':
 		io.WriteString(s, p.Summary())
@@ -137,6 +297,65 @@ func (p List) Format(s fmt.State, verb rune) {
 	}
 }
 
+// Unwrap returns the members of p so that errors.Is and errors.As can
+// traverse into them (see errors.Join in Go 1.20).
+func (p List) Unwrap() []error {
+	return p
+}
+
+// Is reports whether any member of p matches target, as defined by errors.Is.
+func (p List) Is(target error) bool {
+	for _, err := range p {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first member of p that matches target, as defined by
+// errors.As, and if so, sets target to that error value and returns true.
+func (p List) As(target interface{}) bool {
+	for _, err := range p {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// --------------------------------------------------------------------
+
+// Append appends errs to err, flattening any List values along the way, and
+// returns the result as an error. It is a convenience constructor for
+// building up a List incrementally, e.g. when replacing
+// hashicorp/go-multierror-style aggregation with this package.
+func Append(err error, errs ...error) error {
+	var p List
+	p = append(p, Flatten(err)...)
+	for _, e := range errs {
+		p = append(p, Flatten(e)...)
+	}
+	return p.ToError()
+}
+
+// Flatten collapses err into a flat slice of errors, expanding nested List
+// values so that repeatedly-aggregated errors don't produce deeply nested
+// trees. A nil err flattens to an empty slice.
+func Flatten(err error) List {
+	if err == nil {
+		return nil
+	}
+	if p, ok := err.(List); ok {
+		var ret List
+		for _, e := range p {
+			ret = append(ret, Flatten(e)...)
+		}
+		return ret
+	}
+	return List{err}
+}
+
 // --------------------------------------------------------------------
 
 // Frame represents an error frame.
@@ -147,16 +366,83 @@ type Frame struct {
 	Code string
 	File string
 	Line int
+
+	// PCs, if non-empty, is the full call stack captured at the point this
+	// Frame was created (see NewWithStack and SetCaptureDepth). It is
+	// symbolized lazily by StackTrace, so capturing it costs little more
+	// than runtime.Callers itself.
+	PCs []uintptr
+}
+
+// StackFrame is one symbolized entry of a Frame's captured call stack.
+type StackFrame struct {
+	Func string
+	File string
+	Line int
+}
+
+// StackTrace symbolizes p.PCs via runtime.CallersFrames. It returns nil if
+// no stack was captured for p.
+func (p *Frame) StackTrace() []StackFrame {
+	if len(p.PCs) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(p.PCs)
+	trace := make([]StackFrame, 0, len(p.PCs))
+	for {
+		f, more := frames.Next()
+		trace = append(trace, StackFrame{Func: f.Function, File: f.File, Line: f.Line})
+		if !more {
+			break
+		}
+	}
+	return trace
 }
 
-// NewWith creates a new error frame.
+// captureDepth is the default depth used by NewWith to capture PCs; 0 (the
+// default) disables capture, preserving NewWith's historical cost.
+var captureDepth = 0
+
+// SetCaptureDepth sets the default stack capture depth used by NewWith.
+// n <= 0 disables capture.
+func SetCaptureDepth(n int) {
+	captureDepth = n
+}
+
+func captureStack(skip, depth int) []uintptr {
+	if depth <= 0 {
+		return nil
+	}
+	pcs := make([]uintptr, depth)
+	n := runtime.Callers(skip, pcs)
+	return pcs[:n]
+}
+
+// NewWith creates a new error frame. It additionally captures a full call
+// stack when SetCaptureDepth has configured a positive depth.
 func NewWith(err error, code string, n int, fn string, args ...interface{}) *Frame {
-	file, line := fileLine()
-	return &Frame{Err: err, Func: fn, Args: args, Code: code, File: file, Line: line + n}
+	file, line := fileLine(0)
+	f := &Frame{Err: err, Func: fn, Args: args, Code: code, File: file, Line: line + n}
+	f.PCs = captureStack(3, captureDepth)
+	return f
+}
+
+// NewWithStack creates a new error frame that always captures a full call
+// stack, regardless of SetCaptureDepth. skip is the number of additional
+// stack frames to ascend past the immediate caller of NewWithStack before
+// recording File/Line and the captured PCs — use it when NewWithStack is
+// itself called through a helper, so both point at the real call site.
+// depth bounds how many stack frames are captured.
+func NewWithStack(err error, code string, skip, depth int, fn string, args ...interface{}) *Frame {
+	file, line := fileLine(skip)
+	return &Frame{
+		Err: err, Func: fn, Args: args, Code: code, File: file, Line: line,
+		PCs: captureStack(3+skip, depth),
+	}
 }
 
-func fileLine() (file string, line int) {
-	_, file, line, _ = runtime.Caller(2)
+func fileLine(skip int) (file string, line int) {
+	_, file, line, _ = runtime.Caller(2 + skip)
 	return
 }
 
@@ -176,10 +462,19 @@ func (p *Frame) Summary() string {
 func errorDetail(b []byte, p *Frame) []byte {
 	if f, ok := p.Err.(*Frame); ok {
 		b = errorDetail(b, f)
-	} else {
-		b = append(b, p.Err.Error()...)
-		b = append(b, "\n\n===> errors stack:\n"...)
+		return appendFrameLine(b, p)
 	}
+	b = append(b, p.Err.Error()...)
+	b = append(b, "\n\n===> errors stack:\n"...)
+	if len(p.PCs) > 0 {
+		return appendStackTrace(b, p)
+	}
+	return appendFrameLine(b, p)
+}
+
+// appendFrameLine renders today's per-frame single-line detail: the call
+// that produced p, and the file:line where it was recorded.
+func appendFrameLine(b []byte, p *Frame) []byte {
 	b = append(b, p.Func...)
 	b = append(b, '(')
 	b = argsDetail(b, p.Args)
@@ -193,6 +488,28 @@ func errorDetail(b []byte, p *Frame) []byte {
 	return b
 }
 
+// appendStackTrace renders the full captured stack of the root frame p,
+// symbolized on demand via StackTrace.
+func appendStackTrace(b []byte, p *Frame) []byte {
+	b = append(b, p.Func...)
+	b = append(b, '(')
+	b = argsDetail(b, p.Args)
+	b = append(b, ")\n"...)
+	for _, sf := range p.StackTrace() {
+		b = append(b, '\t')
+		b = append(b, sf.Func...)
+		b = append(b, "\n\t\t"...)
+		b = append(b, sf.File...)
+		b = append(b, ':')
+		b = strconv.AppendInt(b, int64(sf.Line), 10)
+		b = append(b, '\n')
+	}
+	b = append(b, ' ')
+	b = append(b, p.Code...)
+	b = append(b, '\n')
+	return b
+}
+
 func argsDetail(b []byte, args []interface{}) []byte {
 	nlast := len(args) - 1
 	for i, arg := range args {
@@ -240,6 +557,10 @@ func (p *Frame) Unwrap() error {
 func (p *Frame) Format(s fmt.State, verb rune) {
 	switch verb {
 	case 'v':
+		if s.Flag('+') {
+			s.Write(FormatWith(p, defaultFormatter))
+			return
+		}
 		io.WriteString(s, p.Error())
 	case 's':
 		io.WriteString(s, p.Summary())
@@ -250,6 +571,127 @@ func (p *Frame) Format(s fmt.State, verb rune) {
 
 // --------------------------------------------------------------------
 
+// Formatter renders a *Frame or a List into a byte representation. It lets
+// callers plug in structured output (e.g. JSON) in place of the default
+// plaintext stack rendering.
+type Formatter interface {
+	FormatError(*Frame) []byte
+	FormatList(List) []byte
+}
+
+var defaultFormatter Formatter = textFormatter{}
+
+// SetDefaultFormatter sets the Formatter used by the %+v verb on *Frame and
+// List. Passing nil restores the plaintext default.
+func SetDefaultFormatter(f Formatter) {
+	if f == nil {
+		f = textFormatter{}
+	}
+	defaultFormatter = f
+}
+
+// FormatWith renders err with f. If err is neither a *Frame nor a List, it
+// falls back to err.Error().
+func FormatWith(err error, f Formatter) []byte {
+	switch e := err.(type) {
+	case *Frame:
+		return f.FormatError(e)
+	case List:
+		return f.FormatList(e)
+	default:
+		return []byte(err.Error())
+	}
+}
+
+// textFormatter is the default plaintext Formatter, matching the historical
+// Error() output.
+type textFormatter struct{}
+
+func (textFormatter) FormatError(p *Frame) []byte {
+	return errorDetail(make([]byte, 0, 32), p)
+}
+
+func (textFormatter) FormatList(p List) []byte {
+	return []byte(p.Error())
+}
+
+// jsonFormatter renders a *Frame as a JSON array of frames, innermost first,
+// each with its func, file, line, code and stringified args. A List renders
+// as a JSON array of such arrays, one per member.
+type jsonFormatter struct{}
+
+// JSONFormatter is the stock JSON Formatter, suitable for piping structured
+// errors into log aggregators.
+var JSONFormatter Formatter = jsonFormatter{}
+
+type jsonFrame struct {
+	Func string   `json:"func,omitempty"`
+	File string   `json:"file,omitempty"`
+	Line int      `json:"line,omitempty"`
+	Code string   `json:"code,omitempty"`
+	Args []string `json:"args,omitempty"`
+	Msg  string   `json:"msg,omitempty"`
+}
+
+// framesFor walks err into a flat []jsonFrame, innermost first. A plain
+// (non-Frame) err renders as a single jsonFrame carrying its message.
+func framesFor(err error) []jsonFrame {
+	var frames []jsonFrame
+	var walk func(err error)
+	walk = func(err error) {
+		f, ok := err.(*Frame)
+		if !ok {
+			frames = append(frames, jsonFrame{Msg: err.Error()})
+			return
+		}
+		walk(f.Err)
+		frames = append(frames, jsonFrame{
+			Func: f.Func,
+			File: f.File,
+			Line: f.Line,
+			Code: f.Code,
+			Args: jsonArgs(f.Args),
+		})
+	}
+	walk(err)
+	return frames
+}
+
+// marshalJSON marshals v, falling back to a quoted error string rather than
+// silently discarding a marshal failure.
+func marshalJSON(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return []byte(strconv.Quote(err.Error()))
+	}
+	return b
+}
+
+func (jsonFormatter) FormatError(p *Frame) []byte {
+	return marshalJSON(framesFor(p))
+}
+
+func (jsonFormatter) FormatList(list List) []byte {
+	all := make([][]jsonFrame, len(list))
+	for i, err := range list {
+		all[i] = framesFor(err)
+	}
+	return marshalJSON(all)
+}
+
+func jsonArgs(args []interface{}) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	out := make([]string, len(args))
+	for i, arg := range args {
+		out[i] = string(appendValue(nil, arg))
+	}
+	return out
+}
+
+// --------------------------------------------------------------------
+
 // CallDetail print a function call shortly.
 func CallDetail(msg []byte, fn interface{}, args ...interface{}) []byte {
 	f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer())
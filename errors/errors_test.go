@@ -0,0 +1,224 @@
+/*
+ Copyright 2022 Qiniu Limited (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package errors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+type customErr struct{ msg string }
+
+func (e *customErr) Error() string { return e.msg }
+
+func TestJSONFormatterFormatList(t *testing.T) {
+	frame := NewFrame(errors.New("root cause"), "E1001", "a.go", 10, "doStuff")
+	list := List{errors.New("plain"), frame}
+
+	b := JSONFormatter.FormatList(list)
+
+	var got [][]jsonFrame
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("FormatList produced invalid JSON: %v (%s)", err, b)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d members, want 2", len(got))
+	}
+
+	if len(got[0]) != 1 || got[0][0].Msg != "plain" {
+		t.Errorf("plain error member = %+v, want single frame with Msg %q", got[0], "plain")
+	}
+
+	if len(got[1]) != 2 {
+		t.Fatalf("frame member has %d frames, want 2", len(got[1]))
+	}
+	if got[1][0].Msg != "root cause" {
+		t.Errorf("inner frame Msg = %q, want %q", got[1][0].Msg, "root cause")
+	}
+	if got[1][1].Func != "doStuff" || got[1][1].File != "a.go" || got[1][1].Line != 10 || got[1][1].Code != "E1001" {
+		t.Errorf("outer frame = %+v, want Func doStuff, File a.go, Line 10, Code E1001", got[1][1])
+	}
+}
+
+func TestJSONFormatterFormatError(t *testing.T) {
+	frame := NewFrame(errors.New("boom"), "E1", "a.go", 1, "fn")
+
+	b := JSONFormatter.FormatError(frame)
+
+	var got []jsonFrame
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("FormatError produced invalid JSON: %v (%s)", err, b)
+	}
+	if len(got) != 2 || got[0].Msg != "boom" || got[1].Func != "fn" {
+		t.Errorf("got %+v, want [{Msg:boom} {Func:fn ...}]", got)
+	}
+}
+
+func TestHTTPStatusAndGRPCCode(t *testing.T) {
+	cases := []struct {
+		kind   Kind
+		status int
+		code   codes.Code
+	}{
+		{KindNotFound, http.StatusNotFound, codes.NotFound},
+		{KindAlreadyExists, http.StatusConflict, codes.AlreadyExists},
+		{KindPermissionDenied, http.StatusForbidden, codes.PermissionDenied},
+		{KindUnauthenticated, http.StatusUnauthorized, codes.Unauthenticated},
+		{KindInvalidArgument, http.StatusBadRequest, codes.InvalidArgument},
+		{KindResourceExhausted, http.StatusTooManyRequests, codes.ResourceExhausted},
+		{KindUnavailable, http.StatusServiceUnavailable, codes.Unavailable},
+		{KindDeadlineExceeded, http.StatusGatewayTimeout, codes.DeadlineExceeded},
+		{KindCanceled, 499, codes.Canceled},
+		{KindInternal, http.StatusInternalServerError, codes.Internal},
+	}
+	for _, c := range cases {
+		err := NewCoded(c.kind, "thing")
+		if got := HTTPStatus(err); got != c.status {
+			t.Errorf("HTTPStatus(%v) = %d, want %d", c.kind, got, c.status)
+		}
+		if got := GRPCCode(err); got != c.code {
+			t.Errorf("GRPCCode(%v) = %v, want %v", c.kind, got, c.code)
+		}
+	}
+
+	// Wrapped in a Frame, and an unrecognized error, still map sensibly.
+	wrapped := NewFrame(NewCoded(KindNotFound, "user"), "E404", "a.go", 1, "fn")
+	if got := HTTPStatus(wrapped); got != http.StatusNotFound {
+		t.Errorf("HTTPStatus(wrapped NotFound) = %d, want %d", got, http.StatusNotFound)
+	}
+
+	plain := errors.New("boom")
+	if got := HTTPStatus(plain); got != http.StatusInternalServerError {
+		t.Errorf("HTTPStatus(plain) = %d, want %d", got, http.StatusInternalServerError)
+	}
+	if got := GRPCCode(plain); got != codes.Internal {
+		t.Errorf("GRPCCode(plain) = %v, want %v", got, codes.Internal)
+	}
+}
+
+func TestIsNotFoundBackwardCompat(t *testing.T) {
+	nf := &NotFound{Category: "user"}
+	if nf.Error() != "user not found" {
+		t.Errorf("NotFound.Error() = %q, want %q", nf.Error(), "user not found")
+	}
+	if !IsNotFound(nf) {
+		t.Errorf("IsNotFound(%v) = false, want true", nf)
+	}
+	if !Is(nf, KindNotFound) {
+		t.Errorf("Is(%v, KindNotFound) = false, want true", nf)
+	}
+}
+
+func TestFrameStackTrace(t *testing.T) {
+	orig := captureDepth
+	SetCaptureDepth(0)
+	defer SetCaptureDepth(orig)
+
+	withoutStack := NewWith(errors.New("boom"), "E1", 0, "fn")
+	if trace := withoutStack.StackTrace(); trace != nil {
+		t.Errorf("StackTrace() = %v, want nil when capture is disabled", trace)
+	}
+
+	f := NewWithStack(errors.New("boom"), "E1", 0, 32, "fn")
+	trace := f.StackTrace()
+	if len(trace) == 0 {
+		t.Fatal("StackTrace() is empty, want at least the calling frame")
+	}
+	if !strings.Contains(trace[0].Func, "TestFrameStackTrace") {
+		t.Errorf("StackTrace()[0].Func = %q, want it to contain %q", trace[0].Func, "TestFrameStackTrace")
+	}
+}
+
+func TestListUnwrapIsAs(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	wrapped := fmt.Errorf("wrap: %w", sentinel)
+	custom := &customErr{msg: "custom"}
+	list := List{errors.New("plain"), wrapped, custom}
+
+	if members := list.Unwrap(); len(members) != len(list) {
+		t.Fatalf("Unwrap() returned %d members, want %d", len(members), len(list))
+	} else {
+		for i, m := range members {
+			if m != list[i] {
+				t.Errorf("Unwrap()[%d] = %v, want %v", i, m, list[i])
+			}
+		}
+	}
+
+	if !errors.Is(list, sentinel) {
+		t.Error("errors.Is(list, sentinel) = false, want true")
+	}
+	if errors.Is(list, errors.New("unrelated")) {
+		t.Error("errors.Is(list, unrelated) = true, want false")
+	}
+	if !list.Is(sentinel) {
+		t.Error("list.Is(sentinel) = false, want true")
+	}
+
+	var target *customErr
+	if !errors.As(list, &target) || target != custom {
+		t.Errorf("errors.As(list, &target) = (%v, found), want (%v, true)", target, custom)
+	}
+	target = nil
+	if !list.As(&target) || target != custom {
+		t.Errorf("list.As(&target) = (%v, found), want (%v, true)", target, custom)
+	}
+}
+
+func TestAppendFlatten(t *testing.T) {
+	if got := Append(nil); got != nil {
+		t.Errorf("Append(nil) = %v, want nil", got)
+	}
+
+	e1 := errors.New("e1")
+	if got := Append(nil, e1); got != e1 {
+		t.Errorf("Append(nil, e1) = %v, want e1 itself (ToError single-element collapse)", got)
+	}
+
+	e2, e3 := errors.New("e2"), errors.New("e3")
+	nested := Append(e1, e2)
+	got := Append(nested, e3)
+	list, ok := got.(List)
+	if !ok {
+		t.Fatalf("Append(nested, e3) = %T, want List (nested List flattened, not wrapped)", got)
+	}
+	want := []error{e1, e2, e3}
+	if len(list) != len(want) {
+		t.Fatalf("Append result has %d members, want %d: %v", len(list), len(want), list)
+	}
+	for i, w := range want {
+		if list[i] != w {
+			t.Errorf("Append result[%d] = %v, want %v", i, list[i], w)
+		}
+	}
+
+	if got := Flatten(nil); got != nil {
+		t.Errorf("Flatten(nil) = %v, want nil", got)
+	}
+	if got := Flatten(e1); len(got) != 1 || got[0] != e1 {
+		t.Errorf("Flatten(e1) = %v, want [e1]", got)
+	}
+	if got := Flatten(nested); len(got) != 2 || got[0] != e1 || got[1] != e2 {
+		t.Errorf("Flatten(nested) = %v, want [e1 e2]", got)
+	}
+}